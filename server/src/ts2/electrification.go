@@ -0,0 +1,120 @@
+package ts2
+
+import "fmt"
+
+// TrackItemSchemaVersion is the version of the flat per-item JSON map
+// layout format (the item shape produced by e.g. formats/osm.BuildLayout
+// and read back by MigrateTrackItemJSON), bumped whenever a field is added
+// whose absence in a layout saved under an older version must be
+// distinguished from its zero value once decoded. Version 2 added the
+// "electrification" field to every TrackItem.
+const TrackItemSchemaVersion = 2
+
+// MigrateTrackItemJSON rewrites a layout's decoded item maps, saved under
+// fromVersion, so that every field added since is present and explicit
+// rather than left to whatever its Go zero value happens to decode to.
+// Callers loading a layout saved before TrackItemSchemaVersion should run
+// it once before handing the items to the simulation.
+func MigrateTrackItemJSON(items []map[string]interface{}, fromVersion int) []map[string]interface{} {
+	if fromVersion < 2 {
+		for _, item := range items {
+			if _, ok := item["electrification"]; !ok {
+				item["electrification"] = string(ElectrificationNone)
+			}
+		}
+	}
+	return items
+}
+
+/*
+ElectrificationType identifies the traction current system equipping a
+TrackItem. It is serialised as a plain JSON string so that scenario authors
+can also declare layout-specific systems beyond the predefined constants.
+ */
+type ElectrificationType string
+
+const (
+	// ElectrificationNone is a non-electrified section; only diesel, battery
+	// or bi-mode stock running on its onboard energy can use it.
+	ElectrificationNone ElectrificationType = "none"
+	// ElectrificationDC750ThirdRail is a 750V DC third-rail section, as used
+	// on British third-rail suburban networks.
+	ElectrificationDC750ThirdRail ElectrificationType = "dc750ThirdRail"
+	// ElectrificationAC25kVOverhead is a 25kV AC overhead line section.
+	ElectrificationAC25kVOverhead ElectrificationType = "ac25kVOverhead"
+	// ElectrificationDC1500Overhead is a 1500V DC overhead line section.
+	ElectrificationDC1500Overhead ElectrificationType = "dc1500Overhead"
+)
+
+/*
+IsCompatible reports whether a train equipped with trainElec can legally
+draw power on a section electrified as trackElec, the way the OpenTTD elrail
+code decides whether a wagon can be pulled under a given catenary. A train's
+electrification set always includes ElectrificationNone, since any train can
+run on an unelectrified section under diesel or battery power as long as it
+carries enough onboard energy. IsCompatible does not check onboard energy
+itself; checkElectrification does.
+*/
+func IsCompatible(trainElec []ElectrificationType, trackElec ElectrificationType) bool {
+	if trackElec == ElectrificationNone {
+		return true
+	}
+	for _, e := range trainElec {
+		if e == trackElec {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ElectrificationFailureMode controls what happens when a train reaches a
+track section it cannot draw power from.
+ */
+type ElectrificationFailureMode int
+
+const (
+	// ElectrificationFailureCoast lets the train coast to a stop under its
+	// remaining momentum, as if traction had simply been cut.
+	ElectrificationFailureCoast ElectrificationFailureMode = iota
+	// ElectrificationFailureEvent raises a configurable failure event
+	// instead of just coasting, for scenarios that want to penalise the
+	// dispatcher for routing an incompatible train.
+	ElectrificationFailureEvent
+)
+
+// checkElectrification is called once per simulation step for each running
+// train. It enforces that an electric-only train entering an incompatible
+// section either coasts to a stop or triggers the simulation's configured
+// failure event, and switches bi-mode trains to their compatible mode,
+// logging the transition.
+func (sim *Simulation) checkElectrification(train *Train) {
+	item := train.trainHead()
+	if item == nil {
+		return
+	}
+	trackElec := item.Electrification()
+	tt := train.TrainType
+	// An unelectrified section offers no line power, so although IsCompatible
+	// accepts it for every train, it can only be run on onboard energy.
+	if trackElec != ElectrificationNone && IsCompatible(tt.CompatibleElectrifications, trackElec) {
+		if train.TractionMode == TractionModeOnboard {
+			train.TractionMode = TractionModeLine
+			sim.Log(fmt.Sprintf("%s switches back to line power entering %s", train.Service.Name, item.Name()), "traction")
+		}
+		return
+	}
+	if tt.HasOnboardEnergy() && tt.OnboardEnergy > 0 {
+		if train.TractionMode != TractionModeOnboard {
+			train.TractionMode = TractionModeOnboard
+			sim.Log(fmt.Sprintf("%s switches to onboard energy entering %s", train.Service.Name, item.Name()), "traction")
+		}
+		return
+	}
+	switch sim.Options.ElectrificationFailureMode {
+	case ElectrificationFailureEvent:
+		sim.raiseFailureEvent(train, item)
+	default:
+		train.coastToStop()
+	}
+}
@@ -0,0 +1,84 @@
+package cif
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"ts2"
+)
+
+/*
+ApplyTo expands every schedule of t into one ts2 Service per calendar day it
+actually runs (resolving STP precedence per day via DailyInstances) and
+appends each to sim, binding each LocationCall to a Place through tiplocMap
+(TIPLOC -> PlaceCode). Associations (join/divide/next) are turned into
+linked parent/child services sharing a location suffix, so the timetable
+editor and the simulation can tell which services belong together.
+*/
+func (t *Timetable) ApplyTo(sim *ts2.Simulation, tiplocMap map[string]string) error {
+	instances := t.DailyInstances()
+	days := make([]time.Time, 0, len(instances))
+	for day := range instances {
+		days = append(days, day)
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+
+	serviceByKey := make(map[string]*ts2.Service)
+	for _, day := range days {
+		for _, sched := range instances[day] {
+			service, err := sched.toService(tiplocMap, day)
+			if err != nil {
+				return fmt.Errorf("cif: train %s on %s: %w", sched.TrainUID, day.Format("2006-01-02"), err)
+			}
+			serviceByKey[dailyKey(sched.TrainUID, day)] = service
+			sim.AddService(service)
+		}
+	}
+	for _, day := range days {
+		for _, sched := range instances[day] {
+			if sched.AssociatedUID == "" {
+				continue
+			}
+			parent, ok := serviceByKey[dailyKey(sched.TrainUID, day)]
+			if !ok {
+				continue
+			}
+			child, ok := serviceByKey[dailyKey(sched.AssociatedUID, day)]
+			if !ok {
+				continue
+			}
+			parent.LinkAssociation(sched.AssociationType, child)
+		}
+	}
+	return nil
+}
+
+// dailyKey identifies a single day's resolved service instance for a train
+// UID, used to look services back up when linking associations.
+func dailyKey(uid string, day time.Time) string {
+	return uid + "_" + day.Format("20060102")
+}
+
+// toService builds a ts2.Service for sched's instance on day, translating
+// each LocationCall into a ServiceLine keyed by its Place.
+func (sched Schedule) toService(tiplocMap map[string]string, day time.Time) (*ts2.Service, error) {
+	service := ts2.NewService(dailyKey(sched.TrainUID, day))
+	for _, call := range sched.Calls {
+		placeCode, ok := tiplocMap[call.Tiploc]
+		if !ok {
+			return nil, fmt.Errorf("no PlaceCode mapped for TIPLOC %q", call.Tiploc)
+		}
+		line := ts2.NewServiceLine()
+		line.PlaceCode = placeCode
+		line.TrackCode = call.Platform
+		line.ScheduledArrivalTime = call.Arrival
+		line.ScheduledDepartureTime = call.Departure
+		line.ScheduledPassTime = call.Pass
+		line.PublicArrivalTime = call.PublicArr
+		line.PublicDepartureTime = call.PublicDep
+		line.DoesNotStop = !call.IsStop()
+		service.Lines = append(service.Lines, line)
+	}
+	return service, nil
+}
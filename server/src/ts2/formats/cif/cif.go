@@ -0,0 +1,383 @@
+/*
+Package cif decodes UK-style CIF (Common Interface File) timetable extracts
+and turns them into ts2 Service/ServiceLine objects, so scenarios can be
+bootstrapped from real open railway data instead of hand-authored JSON.
+
+Only the record types needed to build stopping patterns are supported: BS
+(Basic Schedule), BX (Basic Schedule Extra), LO/LI/LT (origin, intermediate
+and terminating locations) and AA (associations).
+*/
+package cif
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// stpIndicator is the STP (short term planning) indicator of a schedule,
+// used to decide which of several overlapping schedules for a train UID
+// takes precedence.
+type stpIndicator byte
+
+const (
+	stpCancellation stpIndicator = 'C'
+	stpNew          stpIndicator = 'N'
+	stpOverlay      stpIndicator = 'O'
+	stpPermanent    stpIndicator = 'P'
+)
+
+// stpPriority ranks indicators from highest to lowest precedence: C beats
+// N, N beats O, O beats P.
+var stpPriority = map[stpIndicator]int{
+	stpCancellation: 0,
+	stpNew:          1,
+	stpOverlay:      2,
+	stpPermanent:    3,
+}
+
+/*
+LocationCall is a single scheduled call at a TIPLOC, carrying both the
+working and public times and the activity codes found on the LO/LI/LT
+record it was parsed from.
+ */
+type LocationCall struct {
+	Tiploc      string
+	Platform    string
+	Arrival     string
+	Departure   string
+	Pass        string
+	PublicArr   string
+	PublicDep   string
+	Activities  []string
+}
+
+// IsStop reports whether this call should generate a passenger stop, based
+// on the TB (train begins), TF (train finishes) and T (stops) activity
+// codes.
+func (lc LocationCall) IsStop() bool {
+	for _, a := range lc.Activities {
+		if a == "TB" || a == "TF" || a == "T" {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Schedule is a single BS/BX schedule as parsed from the file, before STP
+precedence has been resolved and before per-day instances are expanded.
+ */
+type Schedule struct {
+	TrainUID    string
+	STPIndicator stpIndicator
+	DateRunsFrom time.Time
+	DateRunsTo   time.Time
+	DaysRun      [7]bool
+	Calls        []LocationCall
+	// AssociatedUID is the train UID this schedule joins, divides from or
+	// forms the next service of, set from an AA record.
+	AssociatedUID string
+	AssociationType string
+}
+
+/*
+Timetable is the result of decoding a CIF extract: every parsed BS/BX/LO/LI/LT
+schedule, grouped by train UID, with STP precedence not yet resolved. STP
+precedence is date-sensitive (a two-week overlay only outranks the permanent
+schedule for its own two weeks, not for the permanent schedule's whole
+DateRunsFrom/DateRunsTo window), so resolution happens per calendar day, in
+DailyInstances, rather than once per UID at decode time.
+*/
+type Timetable struct {
+	Schedules []Schedule
+}
+
+/*
+Decoder reads CIF records from an io.Reader and accumulates them into a
+Timetable.
+ */
+type Decoder struct {
+	r *bufio.Scanner
+
+	pending    map[string][]Schedule
+	order      []string
+}
+
+// NewDecoder returns a Decoder that reads fixed-width CIF records from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{
+		r:       bufio.NewScanner(r),
+		pending: make(map[string][]Schedule),
+	}
+}
+
+/*
+Decode reads every record from the underlying reader and groups BS/BX/LO/LI/LT
+records by train UID into the returned Timetable, without resolving STP
+precedence yet: see Timetable.DailyInstances. AA records are kept on the
+schedules they reference so the caller can link join/divide/next services.
+*/
+func (d *Decoder) Decode() (*Timetable, error) {
+	var current *Schedule
+	for d.r.Scan() {
+		line := d.r.Text()
+		if len(line) < 2 {
+			continue
+		}
+		switch line[:2] {
+		case "BS":
+			sched, err := parseBS(line)
+			if err != nil {
+				return nil, err
+			}
+			d.addPending(sched)
+			current = d.lastPending(sched.TrainUID)
+		case "BX":
+			if current == nil {
+				return nil, fmt.Errorf("cif: BX record with no preceding BS")
+			}
+			if err := applyBX(current, line); err != nil {
+				return nil, err
+			}
+		case "LO", "LI", "LT":
+			if current == nil {
+				return nil, fmt.Errorf("cif: location record with no preceding BS")
+			}
+			call, err := parseLocation(line)
+			if err != nil {
+				return nil, err
+			}
+			current.Calls = append(current.Calls, call)
+		case "AA":
+			uid, assocUID, assocType, err := parseAA(line)
+			if err != nil {
+				return nil, err
+			}
+			if sched := d.lastPending(uid); sched != nil {
+				sched.AssociatedUID = assocUID
+				sched.AssociationType = assocType
+			}
+		}
+	}
+	if err := d.r.Err(); err != nil {
+		return nil, err
+	}
+	return &Timetable{Schedules: d.schedules()}, nil
+}
+
+func (d *Decoder) addPending(sched Schedule) {
+	if _, ok := d.pending[sched.TrainUID]; !ok {
+		d.order = append(d.order, sched.TrainUID)
+	}
+	d.pending[sched.TrainUID] = append(d.pending[sched.TrainUID], sched)
+}
+
+func (d *Decoder) lastPending(uid string) *Schedule {
+	list := d.pending[uid]
+	if len(list) == 0 {
+		return nil
+	}
+	return &list[len(list)-1]
+}
+
+// schedules flattens every pending schedule, in train-UID arrival order,
+// with STP precedence not yet applied.
+func (d *Decoder) schedules() []Schedule {
+	var all []Schedule
+	for _, uid := range d.order {
+		all = append(all, d.pending[uid]...)
+	}
+	return all
+}
+
+// RunsOn reports whether this schedule is scheduled to run on date,
+// according to its DateRunsFrom/DateRunsTo calendar window and its 7-char
+// DaysRun bitmap (Monday first, as in the source BS record).
+func (s Schedule) RunsOn(date time.Time) bool {
+	day := date.Truncate(24 * time.Hour)
+	if day.Before(s.DateRunsFrom) || day.After(s.DateRunsTo) {
+		return false
+	}
+	return s.DaysRun[(int(date.Weekday())+6)%7]
+}
+
+/*
+DailyInstances resolves STP precedence (C cancels, N new, O overlay, P
+permanent) separately for each calendar day a train UID's schedules span, so
+that e.g. a two-week engineering overlay only supersedes the permanent
+schedule for the days they actually overlap, instead of for the permanent
+schedule's entire validity window. Days on which the winning schedule is a
+cancellation are omitted from the result.
+*/
+func (t *Timetable) DailyInstances() map[time.Time][]Schedule {
+	byUID := make(map[string][]Schedule)
+	var order []string
+	for _, s := range t.Schedules {
+		if _, ok := byUID[s.TrainUID]; !ok {
+			order = append(order, s.TrainUID)
+		}
+		byUID[s.TrainUID] = append(byUID[s.TrainUID], s)
+	}
+
+	instances := make(map[time.Time][]Schedule)
+	for _, uid := range order {
+		schedules := byUID[uid]
+		start, end := dateSpan(schedules)
+		for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+			var candidates []Schedule
+			for _, s := range schedules {
+				if s.RunsOn(day) {
+					candidates = append(candidates, s)
+				}
+			}
+			if len(candidates) == 0 {
+				continue
+			}
+			best := candidates[0]
+			for _, s := range candidates[1:] {
+				if stpPriority[s.STPIndicator] < stpPriority[best.STPIndicator] {
+					best = s
+				}
+			}
+			if best.STPIndicator == stpCancellation {
+				continue
+			}
+			instances[day] = append(instances[day], best)
+		}
+	}
+	return instances
+}
+
+// dateSpan returns the earliest DateRunsFrom and latest DateRunsTo across
+// schedules, the range over which STP precedence must be evaluated day by
+// day for a shared train UID.
+func dateSpan(schedules []Schedule) (time.Time, time.Time) {
+	start, end := schedules[0].DateRunsFrom, schedules[0].DateRunsTo
+	for _, s := range schedules[1:] {
+		if s.DateRunsFrom.Before(start) {
+			start = s.DateRunsFrom
+		}
+		if s.DateRunsTo.After(end) {
+			end = s.DateRunsTo
+		}
+	}
+	return start, end
+}
+
+// parseBS parses a fixed-width Basic Schedule record, including the 7-char
+// DaysRun bitmap and the DateRunsFrom/DateRunsTo calendar window.
+func parseBS(line string) (Schedule, error) {
+	if len(line) < 80 {
+		return Schedule{}, fmt.Errorf("cif: BS record too short")
+	}
+	sched := Schedule{
+		TrainUID:     strings.TrimSpace(line[3:9]),
+		STPIndicator: stpIndicator(line[79]),
+	}
+	var err error
+	sched.DateRunsFrom, err = parseDate(line[9:15])
+	if err != nil {
+		return Schedule{}, err
+	}
+	sched.DateRunsTo, err = parseDate(line[15:21])
+	if err != nil {
+		return Schedule{}, err
+	}
+	for i, c := range line[21:28] {
+		sched.DaysRun[i] = c == '1'
+	}
+	return sched, nil
+}
+
+func applyBX(sched *Schedule, line string) error {
+	// BX only carries UIC/ATOC/traction metadata that ts2 does not model
+	// yet; nothing to apply besides validating the record is well formed.
+	if len(line) < 2 {
+		return fmt.Errorf("cif: malformed BX record")
+	}
+	return nil
+}
+
+// parseLocation parses an LO/LI/LT record into a LocationCall, translating
+// the scheduled and public arrival/departure times and the activity codes.
+// LO and LT only carry one scheduled time (departure and arrival
+// respectively) before their Platform field, while LI carries arrival,
+// departure and a scheduled pass time, so Platform and Activity sit at
+// different offsets for each record type rather than behind a shared
+// prefix.
+func parseLocation(line string) (LocationCall, error) {
+	if len(line) < 9 {
+		return LocationCall{}, fmt.Errorf("cif: location record too short")
+	}
+	call := LocationCall{
+		Tiploc: strings.TrimSpace(line[2:9]),
+	}
+	var platform, activity string
+	switch line[:2] {
+	case "LO":
+		if len(line) < 41 {
+			return LocationCall{}, fmt.Errorf("cif: LO record too short")
+		}
+		call.Departure = line[10:15]
+		call.PublicDep = line[15:19]
+		platform = line[19:22]
+		activity = line[29:41]
+	case "LT":
+		if len(line) < 37 {
+			return LocationCall{}, fmt.Errorf("cif: LT record too short")
+		}
+		call.Arrival = line[10:15]
+		call.PublicArr = line[15:19]
+		platform = line[19:22]
+		// Unlike LO, which has a Line field plus engineering and pathing
+		// allowances (7 bytes) between Platform and Activity, LT only has
+		// a 3-byte Path field there, so its Activity column starts 4
+		// bytes earlier than LO's rather than at the same offset.
+		activity = line[25:37]
+	default: // LI
+		if len(line) < 54 {
+			return LocationCall{}, fmt.Errorf("cif: LI record too short")
+		}
+		call.Arrival = line[10:15]
+		call.Departure = line[15:20]
+		call.Pass = line[20:25]
+		call.PublicArr = line[25:29]
+		call.PublicDep = line[29:33]
+		platform = line[33:36]
+		// Line(3) and Path(3) sit between Platform and Activity here (LT
+		// only has Path there, LO has Line plus the two allowances); LI's
+		// allowances follow its Activity field instead.
+		activity = line[42:54]
+	}
+	call.Platform = strings.TrimSpace(platform)
+	activity = strings.TrimSpace(activity)
+	for i := 0; i < len(activity); i += 2 {
+		end := i + 2
+		if end > len(activity) {
+			end = len(activity)
+		}
+		if code := strings.TrimSpace(activity[i:end]); code != "" {
+			call.Activities = append(call.Activities, code)
+		}
+	}
+	return call, nil
+}
+
+// parseAA parses an AA (association) record, returning the main train UID,
+// the UID it is associated with, and the association category (JJ join, VV
+// divide, NP next).
+func parseAA(line string) (uid, assocUID, category string, err error) {
+	if len(line) < 80 {
+		return "", "", "", fmt.Errorf("cif: AA record too short")
+	}
+	// Category (JJ/VV/NP) sits at columns 35-36, not at column 80, which is
+	// the STP indicator BS/BX share - not an association category at all.
+	return strings.TrimSpace(line[3:9]), strings.TrimSpace(line[9:15]), strings.TrimSpace(line[34:36]), nil
+}
+
+func parseDate(s string) (time.Time, error) {
+	return time.Parse("060102", s)
+}
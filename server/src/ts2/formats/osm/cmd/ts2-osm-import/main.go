@@ -0,0 +1,82 @@
+/*
+Command ts2-osm-import reads an .osm extract and writes a ts2 layout JSON
+built from its railway ways and station nodes.
+
+Usage:
+
+	ts2-osm-import <file.osm> --bbox minLat,minLon,maxLat,maxLon --out layout.json
+*/
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"ts2/formats/osm"
+)
+
+func main() {
+	bbox := flag.String("bbox", "", "minLat,minLon,maxLat,maxLon")
+	out := flag.String("out", "layout.json", "output layout JSON path")
+	scale := flag.Float64("scale", 100000, "projection scale, pixels per degree")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		log.Fatal("usage: ts2-osm-import <file.osm> --bbox ... --out layout.json")
+	}
+
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	extract, err := osm.Decode(f)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	opts := osm.Options{Scale: *scale}
+	if *bbox != "" {
+		box, err := parseBBox(*bbox)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts.BBox = box
+	}
+
+	layout, err := osm.BuildLayout(extract, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	data, err := json.MarshalIndent(layout, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(*out, data, 0644); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("wrote %d items to %s\n", len(layout.Items), *out)
+}
+
+func parseBBox(s string) (*osm.BoundingBox, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("bbox must be minLat,minLon,maxLat,maxLon")
+	}
+	values := make([]float64, 4)
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, fmt.Errorf("bbox: %w", err)
+		}
+		values[i] = v
+	}
+	return &osm.BoundingBox{MinLat: values[0], MinLon: values[1], MaxLat: values[2], MaxLon: values[3]}, nil
+}
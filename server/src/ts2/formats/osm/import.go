@@ -0,0 +1,207 @@
+package osm
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Layout is the minimal JSON-serialisable ts2 layout this package produces:
+// a flat list of typed items, each a map so the importer does not need to
+// depend on the exact trackStruct/lineStruct JSON shape.
+type Layout struct {
+	Items []map[string]interface{} `json:"items"`
+}
+
+/*
+Options configures how BuildLayout turns a railway Extract into a ts2
+Layout.
+ */
+type Options struct {
+	// Scale converts projected degrees to pixels; see Projection.
+	Scale float64
+	// BBox, if non-zero, restricts the import to ways whose nodes all fall
+	// within [MinLat, MinLon, MaxLat, MaxLon].
+	BBox *BoundingBox
+	// RailwayBlacklist overrides the lifecycle-prefix statuses (see
+	// defaultRailwayBlacklist) that exclude a way from the import. Nil
+	// uses defaultRailwayBlacklist.
+	RailwayBlacklist []string
+}
+
+// BoundingBox is a lat/lon rectangle used to clip an OSM extract to an
+// area of interest before importing it.
+type BoundingBox struct {
+	MinLat, MinLon, MaxLat, MaxLon float64
+}
+
+// contains reports whether (lat, lon) falls within the bounding box.
+func (b *BoundingBox) contains(lat, lon float64) bool {
+	return lat >= b.MinLat && lat <= b.MaxLat && lon >= b.MinLon && lon <= b.MaxLon
+}
+
+// waysInBBox returns the ways of ways whose nodes all fall within bbox, as
+// Options.BBox documents. A way with any node outside bbox (or referencing
+// an unknown node) is dropped outright rather than imported with a
+// dangling previousTiId/nextTiId at the excluded end.
+func waysInBBox(ways []*Way, nodes map[int64]*Node, bbox *BoundingBox) []*Way {
+	var kept []*Way
+	for _, w := range ways {
+		inBBox := true
+		for _, id := range w.Nodes {
+			n := nodes[id]
+			if n == nil || !bbox.contains(n.Lat, n.Lon) {
+				inBBox = false
+				break
+			}
+		}
+		if inBBox {
+			kept = append(kept, w)
+		}
+	}
+	return kept
+}
+
+// BuildLayout turns the railway ways and station nodes of e into a ts2
+// Layout: each way becomes a chain of LineItems between its nodes, shared
+// nodes become EndItems (two ways) or are fused into PointsItems (three
+// ways), and station/stop-position nodes become Places with a PlatformItem
+// attached.
+func BuildLayout(e *Extract, opts Options) (*Layout, error) {
+	ways := e.RailwayWays(opts.RailwayBlacklist)
+	if opts.BBox != nil {
+		ways = waysInBBox(ways, e.Nodes, opts.BBox)
+	}
+	proj := NewProjection(e.Nodes, opts.Scale)
+
+	nodeWayCount := make(map[int64]int)
+	for _, w := range ways {
+		endpoints := []int64{w.Nodes[0], w.Nodes[len(w.Nodes)-1]}
+		for _, id := range endpoints {
+			nodeWayCount[id]++
+		}
+	}
+
+	layout := &Layout{}
+	// nextID starts at 1, not 0: an absent previousTiId/nextTiId/
+	// reverseTiId deserializes to Go's zero value 0, which trackStruct
+	// relies on elsewhere to mean "no link" (see the EndItem doc comment on
+	// every free end needing to be explicitly wired, even a dead end, "to
+	// prevent the simulation from crashing"). Starting at 0 would let a real
+	// dead-end EndItem - which only ever populates one of the two fields -
+	// collide with whatever item happened to be assigned id 0.
+	nextID := 1
+	nodeItemID := make(map[int64]int)
+	nodeItem := make(map[int64]map[string]interface{})
+
+	for id, count := range nodeWayCount {
+		node := e.Nodes[id]
+		if node == nil {
+			continue
+		}
+		x, y := proj.Project(node.Lat, node.Lon)
+		itemType := "EndItem"
+		if count >= 3 {
+			itemType = "PointsItem"
+		}
+		nodeItemID[id] = nextID
+		item := map[string]interface{}{
+			"id": nextID, "type": itemType, "x": x, "y": y,
+		}
+		layout.Items = append(layout.Items, item)
+		nodeItem[id] = item
+		nextID++
+	}
+
+	// nodeBranches collects, for every promoted node, the id of each
+	// LineItem found to terminate there, so the reciprocal
+	// previousTiId/nextTiId/reverseTiId can be wired onto the node's own
+	// item once every connecting LineItem has been created.
+	nodeBranches := make(map[int64][]int)
+
+	for _, w := range ways {
+		for i := 0; i < len(w.Nodes)-1; i++ {
+			fromID, toID := w.Nodes[i], w.Nodes[i+1]
+			from, to := e.Nodes[fromID], e.Nodes[toID]
+			if from == nil || to == nil {
+				return nil, fmt.Errorf("osm: way %d references unknown node", w.ID)
+			}
+			x1, y1 := proj.Project(from.Lat, from.Lon)
+			x2, y2 := proj.Project(to.Lat, to.Lon)
+			length := haversine(from.Lat, from.Lon, to.Lat, to.Lon)
+			lineID := nextID
+			item := map[string]interface{}{
+				"id": lineID, "type": "LineItem",
+				"x": x1, "y": y1, "xf": x2, "yf": y2,
+				"realLength": length,
+			}
+			// Segments of one way get consecutive ids, so an interior node
+			// links a segment to its neighbour at lineID-1 or lineID+1.
+			if prevItemID, ok := nodeItemID[fromID]; ok {
+				item["previousTiId"] = prevItemID
+				nodeBranches[fromID] = append(nodeBranches[fromID], lineID)
+			} else if i > 0 {
+				item["previousTiId"] = lineID - 1
+			}
+			if nextItemID, ok := nodeItemID[toID]; ok {
+				item["nextTiId"] = nextItemID
+				nodeBranches[toID] = append(nodeBranches[toID], lineID)
+			} else if i < len(w.Nodes)-2 {
+				item["nextTiId"] = lineID + 1
+			}
+			layout.Items = append(layout.Items, item)
+			nextID++
+		}
+	}
+
+	// Wire the reciprocal links onto every promoted node now that the ids
+	// of all its connecting LineItems are known: an EndItem links its (up
+	// to) two branches as previousTiId/nextTiId, and a PointsItem also
+	// links its third branch as reverseTiId. Branch order is taken from
+	// the sorted LineItem ids rather than map iteration order, so common,
+	// normal and reverse are assigned deterministically; OSM data carries
+	// no notion of which branch is "normal" versus "reverse", so this is
+	// only a starting point for a layout author to refine. The common,
+	// normal and reverse end coordinates default to the node's own
+	// position, which is (0, 0) in the item coordinates PointsItem measures
+	// its ends in, relative to its center: real branch geometry (the fan of
+	// a PointsItem, per the doc comment on PointsItem) is an editor-level
+	// layout concern this importer does not attempt to synthesize.
+	for nodeID, branches := range nodeBranches {
+		item := nodeItem[nodeID]
+		sort.Ints(branches)
+		x, y := 0.0, 0.0
+		item["previousTiId"] = branches[0]
+		if len(branches) > 1 {
+			item["nextTiId"] = branches[1]
+		}
+		if item["type"] == "PointsItem" {
+			item["xf"], item["yf"] = x, y
+			if len(branches) > 1 {
+				item["xn"], item["yn"] = x, y
+			}
+			if len(branches) > 2 {
+				item["reverseTiId"] = branches[2]
+				item["xr"], item["yr"] = x, y
+			}
+		}
+	}
+
+	for _, n := range e.StationNodes() {
+		if opts.BBox != nil && !opts.BBox.contains(n.Lat, n.Lon) {
+			continue
+		}
+		x, y := proj.Project(n.Lat, n.Lon)
+		placeID := nextID
+		name := n.Tags["name"]
+		layout.Items = append(layout.Items, map[string]interface{}{
+			"id": placeID, "type": "Place", "name": name, "x": x, "y": y,
+		})
+		nextID++
+		layout.Items = append(layout.Items, map[string]interface{}{
+			"id": nextID, "type": "PlatformItem", "placeCode": name, "x": x, "y": y,
+		})
+		nextID++
+	}
+
+	return layout, nil
+}
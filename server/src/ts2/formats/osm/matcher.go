@@ -0,0 +1,264 @@
+package osm
+
+import "math"
+
+// matcherSigma is the standard deviation, in meters, of the assumed GPS
+// measurement noise used to weight candidate edges in the Viterbi matcher.
+const matcherSigma = 30.0
+
+// matcherGranularity is the spacing, in meters, at which candidate points
+// are sampled along each LineItem segment of the track graph.
+const matcherGranularity = 50.0
+
+// endpointPrecision rounds a segment endpoint's projected coordinates to
+// the nearest 1/1000 pixel before using them as a graph-node key, so that
+// two segments sharing an OSM node (and therefore the exact same projected
+// coordinates) are recognised as meeting there despite float rounding.
+const endpointPrecision = 1000.0
+
+// TracePoint is a single recorded GPS fix from a real train run.
+type TracePoint struct {
+	Lat float64
+	Lon float64
+}
+
+// candidate is a point sampled along the track graph at matcherGranularity
+// spacing, used as a possible match for a single TracePoint. t is the
+// candidate's position along its segment, from 0 (origin) to 1 (end).
+type candidate struct {
+	segment int
+	x, y    float64
+	t       float64
+}
+
+// endpointKey identifies one end of a segment by its rounded coordinates,
+// used as a node identity in the segment-adjacency graph built for
+// networkDistance.
+type endpointKey [2]int64
+
+func keyFor(x, y float64) endpointKey {
+	return endpointKey{int64(math.Round(x * endpointPrecision)), int64(math.Round(y * endpointPrecision))}
+}
+
+// segmentEdge is one hop of the endpoint-adjacency graph: travelling along
+// a whole segment from one of its ends to the other costs weight (the
+// segment's pixel length).
+type segmentEdge struct {
+	to     endpointKey
+	weight float64
+}
+
+/*
+Matcher snaps a sequence of recorded GPS TracePoints onto the LineItem
+graph produced by BuildLayout, using a Viterbi-style hidden Markov map
+matcher (sigma ~30m emission noise, ~50m candidate spacing). This lets ts2
+drive a scenario from a real recorded train run, and keeps the door open
+for deriving a timetable from the matched trace later.
+
+Transitions between candidates are weighted by how well the straight-line
+gap between them agrees with the distance actually walked along the track
+graph (networkDistance): a transition that requires a long detour through
+the graph to cover what looks like a short gap is penalised, the same way
+a transition onto an unreachable segment would be in a standard map
+matcher.
+ */
+type Matcher struct {
+	segments   [][2][2]float64 // [x0,y0],[x1,y1] per LineItem in pixel space
+	segmentLen []float64
+	proj       Projection
+	graph      map[endpointKey][]segmentEdge
+}
+
+// NewMatcher builds a Matcher from the LineItem segments of layout,
+// projected with proj (the same projection BuildLayout used, so trace
+// points and track geometry share one coordinate system). It also builds
+// the endpoint-adjacency graph used to compute network distances between
+// candidates on different segments.
+func NewMatcher(layout *Layout, proj Projection) *Matcher {
+	m := &Matcher{proj: proj, graph: make(map[endpointKey][]segmentEdge)}
+	for _, item := range layout.Items {
+		if item["type"] != "LineItem" {
+			continue
+		}
+		seg := [2][2]float64{
+			{item["x"].(float64), item["y"].(float64)},
+			{item["xf"].(float64), item["yf"].(float64)},
+		}
+		m.segments = append(m.segments, seg)
+		length := math.Hypot(seg[1][0]-seg[0][0], seg[1][1]-seg[0][1])
+		m.segmentLen = append(m.segmentLen, length)
+		k0, k1 := keyFor(seg[0][0], seg[0][1]), keyFor(seg[1][0], seg[1][1])
+		m.graph[k0] = append(m.graph[k0], segmentEdge{k1, length})
+		m.graph[k1] = append(m.graph[k1], segmentEdge{k0, length})
+	}
+	return m
+}
+
+// candidatesNear returns the candidate points sampled every
+// matcherGranularity meters along every segment within a few sigma of
+// (x, y).
+func (m *Matcher) candidatesNear(x, y float64) []candidate {
+	var candidates []candidate
+	for segIx, seg := range m.segments {
+		dx, dy := seg[1][0]-seg[0][0], seg[1][1]-seg[0][1]
+		length := math.Hypot(dx, dy)
+		if length == 0 {
+			continue
+		}
+		steps := int(length/matcherGranularity) + 1
+		for s := 0; s <= steps; s++ {
+			t := float64(s) / float64(steps)
+			cx, cy := seg[0][0]+dx*t, seg[0][1]+dy*t
+			if math.Hypot(cx-x, cy-y) <= 4*matcherSigma {
+				candidates = append(candidates, candidate{segment: segIx, x: cx, y: cy, t: t})
+			}
+		}
+	}
+	return candidates
+}
+
+// emissionProb is the Gaussian emission probability of observing (x, y)
+// given the true position is c.
+func emissionProb(x, y float64, c candidate) float64 {
+	d := math.Hypot(c.x-x, c.y-y)
+	return math.Exp(-0.5 * (d * d) / (matcherSigma * matcherSigma))
+}
+
+// networkDistance returns the shortest distance, in pixels, from
+// candidate a to candidate b while staying on the track graph: along their
+// shared segment if they are on the same one, or via Dijkstra over the
+// endpoint-adjacency graph otherwise.
+func (m *Matcher) networkDistance(a, b candidate) float64 {
+	if a.segment == b.segment {
+		return math.Abs(a.t-b.t) * m.segmentLen[a.segment]
+	}
+	segA, segB := m.segments[a.segment], m.segments[b.segment]
+	lenA, lenB := m.segmentLen[a.segment], m.segmentLen[b.segment]
+	aEnd0, aEnd1 := keyFor(segA[0][0], segA[0][1]), keyFor(segA[1][0], segA[1][1])
+	bEnd0, bEnd1 := keyFor(segB[0][0], segB[0][1]), keyFor(segB[1][0], segB[1][1])
+	dist := m.shortestFromSources(map[endpointKey]float64{
+		aEnd0: a.t * lenA,
+		aEnd1: (1 - a.t) * lenA,
+	})
+	best := math.Inf(1)
+	if d, ok := dist[bEnd0]; ok {
+		if v := d + b.t*lenB; v < best {
+			best = v
+		}
+	}
+	if d, ok := dist[bEnd1]; ok {
+		if v := d + (1-b.t)*lenB; v < best {
+			best = v
+		}
+	}
+	return best
+}
+
+// shortestFromSources runs Dijkstra over the endpoint-adjacency graph from
+// several sources at once, each already some distance into the graph (the
+// distance from a candidate to that endpoint along its own segment).
+func (m *Matcher) shortestFromSources(sources map[endpointKey]float64) map[endpointKey]float64 {
+	dist := make(map[endpointKey]float64, len(sources))
+	for k, d := range sources {
+		dist[k] = d
+	}
+	visited := make(map[endpointKey]bool, len(dist))
+	for {
+		var cur endpointKey
+		curDist := math.Inf(1)
+		found := false
+		for k, d := range dist {
+			if visited[k] || d >= curDist {
+				continue
+			}
+			cur, curDist, found = k, d, true
+		}
+		if !found {
+			break
+		}
+		visited[cur] = true
+		for _, e := range m.graph[cur] {
+			nd := curDist + e.weight
+			if existing, ok := dist[e.to]; !ok || nd < existing {
+				dist[e.to] = nd
+			}
+		}
+	}
+	return dist
+}
+
+// transitionWeight scores how plausible it is to move from candidate a to
+// candidate b between two consecutive trace points: it decays with the gap
+// between the straight-line distance separating them and the distance
+// actually walked along the track graph, so a candidate that is nearby in
+// a straight line but only reachable via a long detour (or not reachable
+// at all) is penalised rather than chained to for free.
+func transitionWeight(m *Matcher, a, b candidate) float64 {
+	straightLine := math.Hypot(b.x-a.x, b.y-a.y)
+	network := m.networkDistance(a, b)
+	if math.IsInf(network, 1) {
+		return 0
+	}
+	gap := math.Abs(straightLine - network)
+	return math.Exp(-0.5 * (gap * gap) / (matcherSigma * matcherSigma))
+}
+
+/*
+Match runs the Viterbi algorithm over trace, returning the most likely
+sequence of matched (x, y) positions on the track graph, one per trace
+point with a nearby candidate (points with none are dropped).
+*/
+func (m *Matcher) Match(trace []TracePoint) []struct{ X, Y float64 } {
+	type step struct {
+		cand candidate
+		prob float64
+		prev int
+	}
+	var layers [][]step
+	for _, pt := range trace {
+		x, y := m.proj.Project(pt.Lat, pt.Lon)
+		cands := m.candidatesNear(x, y)
+		if len(cands) == 0 {
+			continue
+		}
+		layer := make([]step, len(cands))
+		for i, c := range cands {
+			layer[i] = step{cand: c, prob: emissionProb(x, y, c), prev: -1}
+		}
+		if len(layers) > 0 {
+			prevLayer := layers[len(layers)-1]
+			for i := range layer {
+				best, bestIx := -1.0, -1
+				for j, p := range prevLayer {
+					score := p.prob * layer[i].prob * transitionWeight(m, p.cand, layer[i].cand)
+					if score > best {
+						best, bestIx = score, j
+					}
+				}
+				if bestIx >= 0 {
+					layer[i].prob = best
+					layer[i].prev = bestIx
+				}
+			}
+		}
+		layers = append(layers, layer)
+	}
+
+	var result []struct{ X, Y float64 }
+	bestIx := -1
+	bestProb := -1.0
+	if len(layers) > 0 {
+		last := layers[len(layers)-1]
+		for i, s := range last {
+			if s.prob > bestProb {
+				bestProb, bestIx = s.prob, i
+			}
+		}
+	}
+	for l := len(layers) - 1; l >= 0 && bestIx >= 0; l-- {
+		s := layers[l][bestIx]
+		result = append([]struct{ X, Y float64 }{{s.cand.x, s.cand.y}}, result...)
+		bestIx = s.prev
+	}
+	return result
+}
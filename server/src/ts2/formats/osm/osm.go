@@ -0,0 +1,165 @@
+/*
+Package osm reads an OpenStreetMap .osm XML extract and synthesizes a ts2
+layout from it: railway ways become LineItems, the nodes where they meet
+become EndItems or PointsItems, and station/stop nodes become Places with
+attached PlatformItems. Binary .pbf extracts are not read (see Decode).
+*/
+package osm
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// defaultRailwayBlacklist is the lifecycle-prefix statuses RailwayWays
+// excludes by default. Real-world OSM data records a disused, abandoned,
+// under-construction, razed or proposed railway with a "<status>:railway"
+// key (e.g. "disused:railway=rail"), a prefix overriding an absent or
+// stale plain "railway" tag - not with railway:status, and not with
+// railway=<status>, which includedRailwayValues already excludes by simply
+// not listing those values.
+var defaultRailwayBlacklist = []string{"disused", "abandoned", "construction", "razed", "proposed"}
+
+// includedRailwayValues are the railway=* values this importer turns into
+// LineItems.
+var includedRailwayValues = map[string]bool{
+	"rail":       true,
+	"light_rail": true,
+	"subway":     true,
+	"tram":       true,
+}
+
+// Node is a single OSM node: an id and a lat/lon pair, plus any tags found
+// on it (stations and stop positions carry tags, most nodes do not).
+type Node struct {
+	ID   int64
+	Lat  float64
+	Lon  float64
+	Tags map[string]string
+}
+
+// Way is a single OSM way: an ordered list of node references and its tags.
+type Way struct {
+	ID    int64
+	Nodes []int64
+	Tags  map[string]string
+}
+
+// Extract is the raw content of an .osm file relevant to this importer:
+// every node and every way, keyed by OSM id.
+type Extract struct {
+	Nodes map[int64]*Node
+	Ways  map[int64]*Way
+}
+
+// rawOSM mirrors the subset of OSM XML this importer reads.
+type rawOSM struct {
+	Nodes []rawNode `xml:"node"`
+	Ways  []rawWay  `xml:"way"`
+}
+
+type rawTag struct {
+	K string `xml:"k,attr"`
+	V string `xml:"v,attr"`
+}
+
+type rawNode struct {
+	ID  int64    `xml:"id,attr"`
+	Lat float64  `xml:"lat,attr"`
+	Lon float64  `xml:"lon,attr"`
+	Tag []rawTag `xml:"tag"`
+}
+
+type rawWay struct {
+	ID  int64      `xml:"id,attr"`
+	ND  []rawNDRef `xml:"nd"`
+	Tag []rawTag   `xml:"tag"`
+}
+
+type rawNDRef struct {
+	Ref int64 `xml:"ref,attr"`
+}
+
+// Decode reads an .osm XML extract from r. Decoding a binary .pbf extract
+// is not implemented yet; callers should convert to .osm XML first (e.g.
+// with osmium) before calling Decode.
+func Decode(r io.Reader) (*Extract, error) {
+	var raw rawOSM
+	if err := xml.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("osm: %w", err)
+	}
+	extract := &Extract{
+		Nodes: make(map[int64]*Node, len(raw.Nodes)),
+		Ways:  make(map[int64]*Way, len(raw.Ways)),
+	}
+	for _, n := range raw.Nodes {
+		node := &Node{ID: n.ID, Lat: n.Lat, Lon: n.Lon}
+		if len(n.Tag) > 0 {
+			node.Tags = make(map[string]string, len(n.Tag))
+			for _, t := range n.Tag {
+				node.Tags[t.K] = t.V
+			}
+		}
+		extract.Nodes[n.ID] = node
+	}
+	for _, w := range raw.Ways {
+		way := &Way{ID: w.ID}
+		way.Nodes = make([]int64, len(w.ND))
+		for i, nd := range w.ND {
+			way.Nodes[i] = nd.Ref
+		}
+		if len(w.Tag) > 0 {
+			way.Tags = make(map[string]string, len(w.Tag))
+			for _, t := range w.Tag {
+				way.Tags[t.K] = t.V
+			}
+		}
+		extract.Ways[w.ID] = way
+	}
+	return extract, nil
+}
+
+// RailwayWays returns the ways of e that are running railway lines: tagged
+// railway=rail|light_rail|subway|tram and not flagged by one of the
+// lifecycle-prefix statuses in blacklist (see defaultRailwayBlacklist). A
+// nil blacklist uses defaultRailwayBlacklist.
+func (e *Extract) RailwayWays(blacklist []string) []*Way {
+	if blacklist == nil {
+		blacklist = defaultRailwayBlacklist
+	}
+	var ways []*Way
+	for _, w := range e.Ways {
+		value := w.Tags["railway"]
+		if !includedRailwayValues[value] {
+			continue
+		}
+		excluded := false
+		for _, status := range blacklist {
+			if _, ok := w.Tags[status+":railway"]; ok {
+				excluded = true
+				break
+			}
+		}
+		if excluded {
+			continue
+		}
+		ways = append(ways, w)
+	}
+	return ways
+}
+
+// StationNodes returns the nodes of e tagged as a station or a stop
+// position: railway=station or public_transport=stop_position.
+func (e *Extract) StationNodes() []*Node {
+	var nodes []*Node
+	for _, n := range e.Nodes {
+		if n.Tags == nil {
+			continue
+		}
+		if n.Tags["railway"] == "station" || n.Tags["public_transport"] == "stop_position" {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
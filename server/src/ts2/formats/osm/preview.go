@@ -0,0 +1,82 @@
+package osm
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+RenderPreviewSVG rasterizes a Layout to a quick SVG preview using
+Bresenham-style line rasterization, for eyeballing an import before it is
+used as canonical scenery geometry. The canonical LineItem coordinates
+produced by BuildLayout are exact floating point projections; this
+rasterized grid is for preview purposes only.
+*/
+func RenderPreviewSVG(layout *Layout, width, height int) string {
+	grid := make([][]bool, height)
+	for i := range grid {
+		grid[i] = make([]bool, width)
+	}
+
+	for _, item := range layout.Items {
+		if item["type"] != "LineItem" {
+			continue
+		}
+		x0, y0 := int(item["x"].(float64)), int(item["y"].(float64))
+		x1, y1 := int(item["xf"].(float64)), int(item["yf"].(float64))
+		bresenham(x0, y0, x1, y1, func(x, y int) {
+			if x >= 0 && x < width && y >= 0 && y < height {
+				grid[y][x] = true
+			}
+		})
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d">`, width, height)
+	for y, row := range grid {
+		for x, set := range row {
+			if set {
+				fmt.Fprintf(&sb, `<rect x="%d" y="%d" width="1" height="1"/>`, x, y)
+			}
+		}
+	}
+	sb.WriteString(`</svg>`)
+	return sb.String()
+}
+
+// bresenham walks the integer pixels of the line from (x0, y0) to (x1, y1),
+// calling plot for each one.
+func bresenham(x0, y0, x1, y1 int, plot func(x, y int)) {
+	dx := abs(x1 - x0)
+	dy := -abs(y1 - y0)
+	sx, sy := 1, 1
+	if x0 >= x1 {
+		sx = -1
+	}
+	if y0 >= y1 {
+		sy = -1
+	}
+	err := dx + dy
+	for {
+		plot(x0, y0)
+		if x0 == x1 && y0 == y1 {
+			break
+		}
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			err += dx
+			y0 += sy
+		}
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,62 @@
+package osm
+
+import "math"
+
+// earthRadius is the mean Earth radius in meters, used by both the
+// haversine distance and the equirectangular projection.
+const earthRadius = 6371000.0
+
+// toRadians converts degrees to radians.
+func toRadians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+// haversine returns the great-circle distance in meters between two
+// lat/lon points, used as the RealLength of the LineItem generated from an
+// OSM way segment.
+func haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	phi1, phi2 := toRadians(lat1), toRadians(lat2)
+	dPhi := toRadians(lat2 - lat1)
+	dLambda := toRadians(lon2 - lon1)
+	a := math.Sin(dPhi/2)*math.Sin(dPhi/2) +
+		math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+	return earthRadius * c
+}
+
+/*
+Projection maps lat/lon coordinates to the flat pixel coordinate system
+ts2's scenery editor expects, using an equirectangular projection centered
+on the extract's centroid. This keeps distances roughly correct near the
+centroid without requiring a full map-projection library, which is enough
+for the modest geographic extent of a single layout.
+*/
+type Projection struct {
+	centerLat float64
+	centerLon float64
+	// scale converts projected degrees to pixels.
+	scale float64
+}
+
+// NewProjection returns a Projection centered on the centroid of nodes.
+func NewProjection(nodes map[int64]*Node, scale float64) Projection {
+	var sumLat, sumLon float64
+	for _, n := range nodes {
+		sumLat += n.Lat
+		sumLon += n.Lon
+	}
+	count := float64(len(nodes))
+	if count == 0 {
+		return Projection{scale: scale}
+	}
+	return Projection{centerLat: sumLat / count, centerLon: sumLon / count, scale: scale}
+}
+
+// Project converts a lat/lon pair to (x, y) pixel coordinates, y increasing
+// downward to match ts2's scenery coordinate system.
+func (p Projection) Project(lat, lon float64) (x, y float64) {
+	cosCenter := math.Cos(toRadians(p.centerLat))
+	x = (lon - p.centerLon) * cosCenter * p.scale
+	y = -(lat - p.centerLat) * p.scale
+	return x, y
+}
@@ -0,0 +1,280 @@
+package ts2
+
+import (
+	"container/heap"
+	"math"
+)
+
+/*
+PathOptions controls how Simulation.FindPath explores the TrackItem graph.
+ */
+type PathOptions struct {
+	// TimeOptimal makes the cost of an edge be its travel time (RealLength
+	// divided by MaxSpeed) instead of its RealLength.
+	TimeOptimal bool
+	// RespectConflicts excludes items whose ConflictItem() currently carries
+	// an active conflicting route.
+	RespectConflicts bool
+	// MaxCost is the maximum accumulated cost (g score) explored before
+	// giving up. Zero means unbounded.
+	MaxCost float64
+	// Scale converts Origin() pixel distances into the same unit as
+	// RealLength (meters), for layouts drawn to a consistent scale. Zero
+	// (the default) leaves the heuristic at zero, so the search behaves
+	// as plain Dijkstra; set it to opt into a real, admissible Euclidean
+	// heuristic and prune the search. Ignored under TimeOptimal, since
+	// converting a pixel distance into travel time would need an assumed
+	// maximum speed and could easily become inadmissible.
+	Scale float64
+}
+
+/*
+pathNode is a single entry of the A* open/closed sets. Nodes are pooled and
+reset between calls to FindPath so that repeated calls do not put pressure on
+the garbage collector.
+ */
+type pathNode struct {
+	item   TrackItem
+	from   TrackItem
+	fromIx int
+	g      float64
+	f      float64
+	closed bool
+	index  int
+}
+
+/*
+pathHeap is a binary-heap priority queue of *pathNode ordered by f score, as
+used by container/heap.
+ */
+type pathHeap []*pathNode
+
+func (h pathHeap) Len() int            { return len(h) }
+func (h pathHeap) Less(i, j int) bool  { return h[i].f < h[j].f }
+func (h pathHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *pathHeap) Push(x interface{}) {
+	node := x.(*pathNode)
+	node.index = len(*h)
+	*h = append(*h, node)
+}
+
+func (h *pathHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	node := old[n-1]
+	old[n-1] = nil
+	node.index = -1
+	*h = old[:n-1]
+	return node
+}
+
+/*
+pathfinder holds the node map and heap reused across FindPath calls. It is
+reset-on-return the way d2astar-style implementations keep their working set
+warm, since FindPath may be called many times per simulation tick (e.g. for
+auto-routing suggestions or route validation).
+ */
+type pathfinder struct {
+	nodes map[TrackItem]*pathNode
+	open  pathHeap
+}
+
+func newPathfinder() *pathfinder {
+	return &pathfinder{nodes: make(map[TrackItem]*pathNode)}
+}
+
+func (pf *pathfinder) reset() {
+	for k := range pf.nodes {
+		delete(pf.nodes, k)
+	}
+	pf.open = pf.open[:0]
+}
+
+func (pf *pathfinder) nodeFor(item TrackItem) *pathNode {
+	n, ok := pf.nodes[item]
+	if !ok {
+		n = &pathNode{item: item, g: math.Inf(1), f: math.Inf(1)}
+		pf.nodes[item] = n
+	}
+	return n
+}
+
+// heuristic estimates the remaining cost from from to to. Origin() is in
+// scene pixels while g accumulates RealLength meters (or travel-time seconds
+// under TimeOptimal), so without a caller-supplied opts.Scale there is no
+// way to convert between them and a Euclidean pixel distance is not
+// admissible; heuristic then returns zero, which keeps it trivially
+// admissible and makes the search behave as Dijkstra rather than true A*.
+// With opts.Scale set (and TimeOptimal unset), the scaled Euclidean
+// distance is an admissible estimate of the remaining RealLength, since the
+// track path between two items is never shorter than the straight line
+// between their origins.
+func heuristic(from, to TrackItem, opts PathOptions) float64 {
+	if opts.Scale <= 0 || opts.TimeOptimal {
+		return 0
+	}
+	fromOrigin, toOrigin := from.Origin(), to.Origin()
+	dx, dy := toOrigin.X-fromOrigin.X, toOrigin.Y-fromOrigin.Y
+	return math.Hypot(dx, dy) * opts.Scale
+}
+
+// edgeCost returns the cost of traversing item, either its RealLength, or
+// its travel time at MaxSpeed when opts.TimeOptimal is set.
+func edgeCost(item TrackItem, opts PathOptions) float64 {
+	length := item.RealLength()
+	if !opts.TimeOptimal {
+		return length
+	}
+	speed := item.MaxSpeed()
+	if speed <= 0 {
+		return length
+	}
+	return length / speed
+}
+
+// hasActiveConflict reports whether item's conflicting item currently
+// carries an active route.
+func hasActiveConflict(item TrackItem) bool {
+	conflict := item.ConflictItem()
+	if conflict == nil {
+		return false
+	}
+	return conflict.hasActiveRoute()
+}
+
+// neighbors returns the TrackItems reachable from item when arriving from
+// precedingItem, expanding both branches of a PointsItem from its common end
+// but never crossing between the normal and reverse branches. A nil
+// precedingItem means item is the search's own starting point, so every
+// direction out of it is tried rather than just the ones a real arrival
+// direction would allow.
+func neighbors(item, precedingItem TrackItem) []TrackItem {
+	if points, ok := item.(PointsItem); ok {
+		pointsItem := TrackItem(points)
+		switch {
+		case precedingItem == nil:
+			// item is the search's own starting point, so there is no
+			// "arrived from" direction to restrict it to: every branch is
+			// a valid way out.
+			return []TrackItem{pointsItem.PreviousItem(), pointsItem.NextItem(), points.ReverseItem()}
+		case precedingItem == pointsItem.PreviousItem():
+			// Arrived from the common end: both the normal and reverse
+			// branches are reachable from here.
+			return []TrackItem{pointsItem.NextItem(), points.ReverseItem()}
+		default:
+			// Arrived from the normal or the reverse end (trackStruct's
+			// FollowingItem has no notion of the reverse link, so it can't
+			// be used here): trains cannot go from normal to reverse end,
+			// so only the common end continues.
+			return []TrackItem{pointsItem.PreviousItem()}
+		}
+	}
+	if precedingItem == nil {
+		// item is the search's own starting point: FollowingItem has no
+		// "arrived from" direction to resolve, so both ends are valid ways
+		// out rather than none.
+		return []TrackItem{item.PreviousItem(), item.NextItem()}
+	}
+	next, err := item.FollowingItem(precedingItem, 0)
+	if err != nil {
+		return nil
+	}
+	return []TrackItem{next}
+}
+
+/*
+FindPath computes a minimum-cost path from one TrackItem to another using A*
+search. The cost (g) of an edge is its RealLength, or its travel time when
+opts.TimeOptimal is set. The heuristic (h) is zero, and the search behaves as
+Dijkstra's algorithm, unless opts.Scale is set on a to-scale, non-TimeOptimal
+layout, in which case it prunes the search with an admissible scaled
+Euclidean distance instead.
+
+FindPath returns the ordered slice of items from (and including) from to (and
+including) to, the total cost, and a non-nil error when no path could be
+found within opts.MaxCost.
+*/
+func (s *Simulation) FindPath(from, to TrackItem, opts PathOptions) ([]TrackItem, float64, error) {
+	if s.pathfinder == nil {
+		s.pathfinder = newPathfinder()
+	}
+	pf := s.pathfinder
+	pf.reset()
+
+	start := pf.nodeFor(from)
+	start.g = 0
+	start.f = heuristic(from, to, opts)
+	heap.Init(&pf.open)
+	heap.Push(&pf.open, start)
+
+	for pf.open.Len() > 0 {
+		current := heap.Pop(&pf.open).(*pathNode)
+		if current.closed {
+			continue
+		}
+		current.closed = true
+
+		if current.item == to {
+			return reconstructPath(pf, current), current.g, nil
+		}
+
+		for _, next := range neighbors(current.item, current.from) {
+			if next == nil {
+				continue
+			}
+			if opts.RespectConflicts && hasActiveConflict(next) {
+				continue
+			}
+			nextNode := pf.nodeFor(next)
+			if nextNode.closed {
+				continue
+			}
+			g := current.g + edgeCost(next, opts)
+			if opts.MaxCost > 0 && g > opts.MaxCost {
+				continue
+			}
+			if g < nextNode.g {
+				nextNode.g = g
+				nextNode.f = g + heuristic(next, to, opts)
+				nextNode.from = current.item
+				heap.Push(&pf.open, nextNode)
+			}
+		}
+	}
+	return nil, 0, errPathNotFound{from, to}
+}
+
+// reconstructPath walks the from-chain built during the search back from
+// dest to the origin and returns it in origin-to-destination order.
+func reconstructPath(pf *pathfinder, dest *pathNode) []TrackItem {
+	var path []TrackItem
+	for n := dest; n != nil; {
+		path = append(path, n.item)
+		if n.from == nil {
+			break
+		}
+		n = pf.nodes[n.from]
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+/*
+errPathNotFound is returned by Simulation.FindPath when no path exists
+between two TrackItems within the given PathOptions.MaxCost.
+ */
+type errPathNotFound struct {
+	from TrackItem
+	to   TrackItem
+}
+
+func (e errPathNotFound) Error() string {
+	return "no path found between " + e.from.Name() + " and " + e.to.Name()
+}
@@ -0,0 +1,76 @@
+/*
+Package ts2 models train motion under tractive effort, running resistance
+and grade resistance.
+
+Scenario authors describing a route's Gradient should think in terms of its
+"ruling gradient": the steepest sustained climb a train will face on that
+route, since it is this single worst section - not the average gradient -
+that determines the maximum trailing load a given TrainType can haul over
+the whole route without stalling.
+*/
+package ts2
+
+import "math"
+
+// gravity is the standard gravitational acceleration in m/s^2, used to turn
+// a track gradient into the force component a train must overcome to climb
+// it.
+const gravity = 9.80665
+
+/*
+gradeResistance returns the force in newtons that mass (in kg) must
+overcome to move on a section whose gradient is gradientPermille, positive
+uphill and negative downhill. It is m*g*sin(atan(grade/1000)), the exact
+form rather than the small-angle m*g*grade/1000 approximation, so that
+steep industrial gradients are not overcounted.
+*/
+func gradeResistance(mass, gradientPermille float64) float64 {
+	return mass * gravity * math.Sin(math.Atan(gradientPermille/1000))
+}
+
+// updateTrainPhysics advances train's speed for one simulation step,
+// drawing tractive effort and mass from its TrainType, and overcoming
+// grade resistance in addition to the train's existing running resistance.
+func (sim *Simulation) updateTrainPhysics(train *Train, dt float64) {
+	tt := train.TrainType
+	item := train.trainHead()
+	if item == nil {
+		return
+	}
+	grade := 0.0
+	if ri, ok := item.(ResizableItem); ok {
+		grade = ri.GradientAt(train.headPositionOnItem())
+	}
+
+	resistance := train.runningResistance() + gradeResistance(tt.Mass, grade)
+
+	effort := tt.TractiveEffort
+	if train.throttle() <= 0 {
+		effort = 0
+	}
+
+	maxBrakeForce := tt.BrakeForce
+	if grade < 0 {
+		// braking on a downhill grade has to fight gravity pulling the
+		// train forward, so the usable brake force is reduced accordingly.
+		maxBrakeForce += gradeResistance(tt.Mass, grade)
+		if maxBrakeForce < 0 {
+			maxBrakeForce = 0
+		}
+	}
+
+	netForce := effort - resistance
+	if train.isBraking() {
+		netForce = -maxBrakeForce
+		if grade >= 0 {
+			// Uphill, maxBrakeForce is untouched above, so gravity's
+			// contribution to slowing the train still needs adding here
+			// as extra deceleration; downhill, it's already folded into
+			// maxBrakeForce, so adding it again here would double-count.
+			netForce -= gradeResistance(tt.Mass, grade)
+		}
+	}
+
+	acceleration := netForce / tt.Mass
+	train.setSpeed(math.Max(0, train.Speed()+acceleration*dt))
+}
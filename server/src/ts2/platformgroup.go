@@ -0,0 +1,119 @@
+package ts2
+
+import (
+	"fmt"
+	"time"
+)
+
+/*
+PlatformGroup is an ordered list of alternative PlatformItems a Place can
+bay a service onto, inspired by the terminal-group approach used by large
+termini where services flexibly take whichever platform is free instead of
+being hard-coded to one in the timetable. A Place owns its groups in
+priority order: Simulation.AllocatePlatform walks them in order and returns
+the first free platform in the first group with capacity.
+*/
+type PlatformGroup struct {
+	Name      string         `json:"name"`
+	Platforms []PlatformItem `json:"-"`
+	// MinTurnaround is the minimum time a platform in this group must stay
+	// reserved after an arrival before it can be reallocated.
+	MinTurnaround time.Duration `json:"minTurnaround"`
+}
+
+// platformReservation records that a PlatformItem is held until
+// releaseTime, either because a service is due or because it is still
+// within its post-arrival turnaround.
+type platformReservation struct {
+	service     *Service
+	releaseTime time.Time
+}
+
+/*
+Simulation is the running state of a scenario: its Trains, TrackItems and
+Places, plus whatever bookkeeping each part of the simulation needs to do
+its job. Like TrainType, it is introduced incrementally, file by file, as
+each piece of simulation logic is added rather than declared all at once;
+platformReservations below is the slice platform allocation owns, and
+pathfinder the one FindPath owns.
+*/
+type Simulation struct {
+	// platformReservations tracks, for every PlatformItem currently held by
+	// a service, when that reservation is released. See AllocatePlatform.
+	platformReservations map[PlatformItem]platformReservation
+	// pathfinder is the node map and heap FindPath reuses across calls,
+	// created on first use.
+	pathfinder *pathfinder
+}
+
+/*
+errNoPlatformAvailable is returned by Simulation.AllocatePlatform when every
+group for a Place is fully reserved at the requested arrival time.
+ */
+type errNoPlatformAvailable struct {
+	place Place
+}
+
+func (e errNoPlatformAvailable) Error() string {
+	return fmt.Sprintf("no platform available at %s", e.place.Name())
+}
+
+// platformFree reports whether platform has no reservation that overlaps
+// arrivalTime.
+func (sim *Simulation) platformFree(platform PlatformItem, arrivalTime time.Time) bool {
+	reservation, ok := sim.platformReservations[platform]
+	if !ok {
+		return true
+	}
+	return !arrivalTime.Before(reservation.releaseTime)
+}
+
+// candidateOrder returns group's platforms with any whose TrackCode matches
+// service's preferred PlaceObject.TrackCode moved to the front, since a
+// declared preferred track is only a soft hint that should bump matching
+// platforms up the candidate list, not exclude the others.
+func candidateOrder(group PlatformGroup, preferredTrackCode string) []PlatformItem {
+	if preferredTrackCode == "" {
+		return group.Platforms
+	}
+	ordered := make([]PlatformItem, 0, len(group.Platforms))
+	var rest []PlatformItem
+	for _, p := range group.Platforms {
+		if p.TrackCode() == preferredTrackCode {
+			ordered = append(ordered, p)
+		} else {
+			rest = append(rest, p)
+		}
+	}
+	return append(ordered, rest...)
+}
+
+/*
+AllocatePlatform finds a stopping point for service's call at arrivalTime.
+It walks service.Place()'s PlatformGroups in priority order and, within
+each group, the candidates ordered by candidateOrder, returning the first
+platform that is not reserved across arrivalTime plus its group's
+MinTurnaround. An error is returned only once every group has been
+exhausted.
+*/
+func (sim *Simulation) AllocatePlatform(service *Service, arrivalTime time.Time) (PlatformItem, error) {
+	place := service.Place()
+	preferredTrackCode := service.TrackCode()
+
+	for _, group := range place.PlatformGroups() {
+		for _, platform := range candidateOrder(group, preferredTrackCode) {
+			if !sim.platformFree(platform, arrivalTime) {
+				continue
+			}
+			if sim.platformReservations == nil {
+				sim.platformReservations = make(map[PlatformItem]platformReservation)
+			}
+			sim.platformReservations[platform] = platformReservation{
+				service:     service,
+				releaseTime: arrivalTime.Add(group.MinTurnaround),
+			}
+			return platform, nil
+		}
+	}
+	return nil, errNoPlatformAvailable{place}
+}
@@ -67,6 +67,9 @@ type TrackItem interface {
 	// Place returns the TrackItem of type Place associated with this item
 	// (as defined by PlaceCode).
 	Place() Place
+	// Electrification returns the type of electrification equipping this
+	// item, or ElectrificationNone if the item is not electrified.
+	Electrification() ElectrificationType
 	// FollowingItem returns the following TrackItem linked to this one,
 	// knowing we come from precedingItem. Returned is either NextItem or
 	// PreviousItem, depending which way we come from.
@@ -74,6 +77,9 @@ type TrackItem interface {
 	// The second argument will return a ItemsNotLinkedError if the given
 	// precedingItem is not linked to this item.
 	FollowingItem(TrackItem, int) (TrackItem, error)
+	// hasActiveRoute reports whether this item currently carries an active
+	// route.
+	hasActiveRoute() bool
 }
 
 /*
@@ -90,6 +96,7 @@ type trackStruct struct {
 	ConflictTiId     int              `json:"conflictTiId"`
 	CustomProperties []customProperty `json:"customProperties"`
 	PlaceCode        string           `json:"placeCode"`
+	TsElectrification ElectrificationType `json:"electrification"`
 
 	simulation       *Simulation
 	activeRoute      *Route
@@ -141,6 +148,23 @@ func (ti *trackStruct) Place() Place {
 	return ti.simulation.Places[ti.PlaceCode]
 }
 
+// Electrification defaults to ElectrificationNone for genuinely
+// unelectrified items. Layouts saved before TrackItemSchemaVersion 2 should
+// be run through MigrateTrackItemJSON first, which makes that default
+// explicit rather than relying on it; this getter's own fallback (the
+// empty-string zero value TsElectrification decodes to otherwise) is
+// defence in depth for items that reach it unmigrated.
+func (ti *trackStruct) Electrification() ElectrificationType {
+	if ti.TsElectrification == "" {
+		return ElectrificationNone
+	}
+	return ti.TsElectrification
+}
+
+func (ti *trackStruct) hasActiveRoute() bool {
+	return ti.activeRoute != nil
+}
+
 func (ti *trackStruct) FollowingItem(precedingItem TrackItem, direction int) (TrackItem, error) {
 	if precedingItem == TrackItem(ti).PreviousItem() {
 		return ti.NextItem(), nil
@@ -160,6 +184,14 @@ type ResizableItem interface {
 	// End returns the two coordinates (Xf, Yf) of the end point of this
 	// ResizeableItem.
 	End() Point
+	// Gradient returns the average slope of this item in permille, signed
+	// positive uphill and negative downhill in the Origin-to-End direction.
+	Gradient() float64
+	// GradientAt interpolates the slope in permille at distanceFromOrigin
+	// meters along the item, for items declaring a piecewise elevation
+	// profile through ElevationStart/ElevationEnd. Items without a profile
+	// just return Gradient().
+	GradientAt(distanceFromOrigin float64) float64
 }
 
 /*
@@ -167,8 +199,11 @@ resizableStruct is a struct the pointer of which implements ResizableItem
  */
 type resizableStruct struct {
 	trackStruct
-	Xf float64 `json:"xf"`
-	Yf float64 `json:"yf"`
+	Xf             float64 `json:"xf"`
+	Yf             float64 `json:"yf"`
+	TsGradient     float64 `json:"gradient"`
+	ElevationStart float64 `json:"elevationStart"`
+	ElevationEnd   float64 `json:"elevationEnd"`
 }
 
 func (ri *resizableStruct) Type() string {
@@ -179,12 +214,33 @@ func (ri *resizableStruct) End() Point {
 	return Point{ri.Xf, ri.Yf}
 }
 
+func (ri *resizableStruct) Gradient() float64 {
+	if ri.ElevationStart != 0 || ri.ElevationEnd != 0 {
+		length := ri.RealLength()
+		if length == 0 {
+			return 0
+		}
+		return (ri.ElevationEnd - ri.ElevationStart) / length * 1000
+	}
+	return ri.TsGradient
+}
+
+func (ri *resizableStruct) GradientAt(distanceFromOrigin float64) float64 {
+	// The elevation profile declared on a single item is linear between
+	// ElevationStart and ElevationEnd, so its local slope is constant and
+	// equal to the item's average Gradient regardless of position.
+	return ri.Gradient()
+}
+
 /*
 A Place is a special TrackItem representing a physical location such as a
 station or a passing point. Place items are not linked to other items.
  */
 type Place interface {
 	TrackItem
+	// PlatformGroups returns this Place's platform groups in priority
+	// order, as set up for Simulation.AllocatePlatform.
+	PlatformGroups() []PlatformGroup
 }
 
 /*
@@ -192,12 +248,17 @@ placeStruct is a struct the pointer of which implements Place
  */
 type placeStruct struct {
 	trackStruct
+	Groups []PlatformGroup `json:"platformGroups"`
 }
 
 func (pl *placeStruct) Type() string {
 	return "Place"
 }
 
+func (pl *placeStruct) PlatformGroups() []PlatformGroup {
+	return pl.Groups
+}
+
 /*
 A PlaceObject is an interface that TrackItem instances that interact with a
 Place should implement.
@@ -0,0 +1,50 @@
+package ts2
+
+/*
+TractionMode identifies which power source a train is currently drawing on.
+Bi-mode trains switch between these as they cross into and out of sections
+whose electrification is incompatible with their line-power equipment.
+*/
+type TractionMode int
+
+const (
+	// TractionModeLine is the default mode: the train draws power from the
+	// track's electrification system.
+	TractionModeLine TractionMode = iota
+	// TractionModeOnboard means the train is running on its own onboard
+	// energy (diesel engine or battery) rather than drawing current from
+	// the track.
+	TractionModeOnboard
+)
+
+/*
+TrainType describes the physical and traction characteristics shared by
+every Train running that class of rolling stock.
+*/
+type TrainType struct {
+	// Mass is the train's mass in kilograms, used to turn tractive and
+	// braking effort into acceleration.
+	Mass float64 `json:"mass"`
+	// TractiveEffort is the maximum force in newtons the train can apply
+	// under power.
+	TractiveEffort float64 `json:"tractiveEffort"`
+	// BrakeForce is the maximum force in newtons the train's brakes can
+	// apply.
+	BrakeForce float64 `json:"brakeForce"`
+	// CompatibleElectrifications lists the electrification systems this
+	// train can draw line power from. ElectrificationNone is implicitly
+	// always compatible (see IsCompatible), so it does not need to be
+	// listed here.
+	CompatibleElectrifications []ElectrificationType `json:"compatibleElectrifications"`
+	// OnboardEnergy is the energy this train carries for running under its
+	// own power (diesel or battery) on sections it cannot draw current
+	// from. Zero means the train has no onboard energy source and must
+	// coast or fail when it meets an incompatible or unelectrified section.
+	OnboardEnergy float64 `json:"onboardEnergy"`
+}
+
+// HasOnboardEnergy reports whether this train type can run under its own
+// power rather than only by drawing current from the track.
+func (tt *TrainType) HasOnboardEnergy() bool {
+	return tt.OnboardEnergy > 0
+}